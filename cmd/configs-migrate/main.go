@@ -0,0 +1,72 @@
+// Command configs-migrate performs a one-shot upgrade of every RuleFormatV1
+// config in the configs DB to RuleFormatV2, using RulesConfig.MigrateToV2.
+// It's meant to be run once during a rollout so the ruler no longer has to
+// carry the legacy rule parser around indefinitely.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/go-kit/kit/log/level"
+	"github.com/prometheus/common/model"
+
+	"github.com/cortexproject/cortex/pkg/configs"
+	"github.com/cortexproject/cortex/pkg/configs/db"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+func main() {
+	dbConfig := db.Config{}
+	dbConfig.RegisterFlags(flag.CommandLine)
+	dryRun := flag.Bool("dry-run", false, "print what would change without writing anything back")
+	groupInterval := flag.Duration("group-interval", 0, "evaluation interval to set on migrated rule groups (0 leaves it unset, falling back to the ruler's default)")
+	flag.Parse()
+
+	d, err := db.New(dbConfig)
+	if err != nil {
+		level.Error(util.Logger).Log("msg", "error connecting to configs DB", "err", err)
+		os.Exit(1)
+	}
+	defer d.Close()
+
+	cfgs, err := d.GetAllConfigs()
+	if err != nil {
+		level.Error(util.Logger).Log("msg", "error loading configs", "err", err)
+		os.Exit(1)
+	}
+
+	migrated, failed := 0, 0
+	for userID, view := range cfgs {
+		if view.Config.RulesConfig.FormatVersion != configs.RuleFormatV1 {
+			continue
+		}
+
+		newRulesConfig, err := view.Config.RulesConfig.MigrateToV2(model.Duration(*groupInterval))
+		if err != nil {
+			level.Error(util.Logger).Log("msg", "error migrating rules config", "user", userID, "err", err)
+			failed++
+			continue
+		}
+
+		view.Config.RulesConfig = newRulesConfig
+		if *dryRun {
+			level.Info(util.Logger).Log("msg", "would migrate config", "user", userID)
+			migrated++
+			continue
+		}
+
+		if err := d.SetConfig(userID, view.Config); err != nil {
+			level.Error(util.Logger).Log("msg", "error saving migrated config", "user", userID, "err", err)
+			failed++
+			continue
+		}
+		migrated++
+	}
+
+	fmt.Printf("migrated %d config(s), %d failure(s)\n", migrated, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,19 +2,25 @@ package configs
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/log"
 	"github.com/prometheus/prometheus/pkg/labels"
 	"github.com/prometheus/prometheus/pkg/rulefmt"
-	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/promql/parser"
 	"github.com/prometheus/prometheus/rules"
 
-	legacy_promql "github.com/cortexproject/cortex/pkg/configs/legacy_promql"
 	"github.com/cortexproject/cortex/pkg/util"
 )
 
+// ErrLegacyRuleFormat is returned by RulesConfig.Parse when a stored config
+// still carries the legacy Prometheus 1.x rule format (RuleFormatV1). Callers
+// should use RulesConfig.MigrateToV2 to upgrade the config once, rather than
+// relying on Parse to understand the legacy syntax forever.
+var ErrLegacyRuleFormat = errors.New("legacy v1 rule format is no longer supported; run RulesConfig.MigrateToV2 to upgrade")
+
 // An ID is the ID of a single users's Cortex configuration. When a
 // configuration changes, it gets a new ID.
 type ID int
@@ -27,12 +33,18 @@ const (
 	RuleFormatV1 RuleFormatVersion = iota
 	// RuleFormatV2 is the Prometheus 2.x rule format.
 	RuleFormatV2 RuleFormatVersion = iota
+	// RuleFormatV3 is RuleFormatV2 plus the newer rulefmt.Rule fields (e.g.
+	// `keep_firing_for`) introduced in later Prometheus releases. It only
+	// exists so RulesConfig.Parse can tell "this config was written against
+	// a ruleset that predates keep_firing_for" apart from "this config uses
+	// it", and reject the field on anything older.
+	RuleFormatV3 RuleFormatVersion = iota
 )
 
 // IsValid returns whether the rules format version is a valid (known) version.
 func (v RuleFormatVersion) IsValid() bool {
 	switch v {
-	case RuleFormatV1, RuleFormatV2:
+	case RuleFormatV1, RuleFormatV2, RuleFormatV3:
 		return true
 	default:
 		return false
@@ -46,6 +58,8 @@ func (v RuleFormatVersion) MarshalJSON() ([]byte, error) {
 		return json.Marshal("1")
 	case RuleFormatV2:
 		return json.Marshal("2")
+	case RuleFormatV3:
+		return json.Marshal("3")
 	default:
 		return nil, fmt.Errorf("unknown rule format version %d", v)
 	}
@@ -62,6 +76,8 @@ func (v *RuleFormatVersion) UnmarshalJSON(data []byte) error {
 		*v = RuleFormatV1
 	case "2":
 		*v = RuleFormatV2
+	case "3":
+		*v = RuleFormatV3
 	default:
 		return fmt.Errorf("unknown rule format version %q", string(data))
 	}
@@ -160,13 +176,24 @@ func (c RulesConfig) Equal(o RulesConfig) bool {
 	return true
 }
 
+// RuleGroup is a single named group of rules parsed out of a RulesConfig,
+// together with the file it came from and its evaluation interval, so
+// callers that need to expose that (e.g. the ruler's /api/v1/rules, or
+// rules.GroupOptions when scheduling evaluation) don't have to re-derive it.
+type RuleGroup struct {
+	Name     string
+	File     string
+	Interval time.Duration
+	Rules    []rules.Rule
+}
+
 // Parse parses and validates the content of the rule files in a RulesConfig
 // according to the passed rule format version.
-func (c RulesConfig) Parse() (map[string][]rules.Rule, error) {
+func (c RulesConfig) Parse() ([]RuleGroup, error) {
 	switch c.FormatVersion {
 	case RuleFormatV1:
-		return c.parseV1()
-	case RuleFormatV2:
+		return nil, ErrLegacyRuleFormat
+	case RuleFormatV2, RuleFormatV3:
 		return c.parseV2()
 	default:
 		return nil, fmt.Errorf("unknown rule format version %v", c.FormatVersion)
@@ -174,20 +201,29 @@ func (c RulesConfig) Parse() (map[string][]rules.Rule, error) {
 }
 
 // parseV2 parses and validates the content of the rule files in a RulesConfig
-// according to the Prometheus 2.x rule format.
+// according to the Prometheus 2.x rule format. It also serves RuleFormatV3,
+// which is the same on-disk format plus the `keep_firing_for` field; the
+// only difference is that keep_firing_for is rejected unless FormatVersion
+// is at least RuleFormatV3.
 //
-// NOTE: On one hand, we cannot return fully-fledged lists of rules.Group
-// here yet, as creating a rules.Group requires already
-// passing in rules.ManagerOptions options (which in turn require a
-// notifier, appender, etc.), which we do not want to create simply
-// for parsing. On the other hand, we should not return barebones
-// rulefmt.RuleGroup sets here either, as only a fully-converted rules.Rule
-// is able to track alert states over multiple rule evaluations. The caller
-// would otherwise have to ensure to convert the rulefmt.RuleGroup only exactly
-// once, not for every evaluation (or risk losing alert pending states). So
-// it's probably better to just return a set of rules.Rule here.
-func (c RulesConfig) parseV2() (map[string][]rules.Rule, error) {
-	groups := map[string][]rules.Rule{}
+// parseV2 reads rulefmt.Rule.KeepFiringFor and calls rules.NewAlertingRule
+// with the keepFiringFor/externalLabels/externalURL arguments for every
+// format version it serves, not only RuleFormatV3, so the vendored
+// github.com/prometheus/prometheus must be new enough to have both.
+//
+// NOTE: On one hand, we cannot return fully-fledged lists of *rules.Group
+// here yet, as creating one requires already passing in rules.ManagerOptions
+// (which in turn require a notifier, appender, etc.), which we do not want
+// to create simply for parsing. On the other hand, we should not return
+// barebones rulefmt.RuleGroup sets here either, as only a fully-converted
+// rules.Rule is able to track alert states over multiple rule evaluations.
+// The caller would otherwise have to ensure to convert the rulefmt.RuleGroup
+// only exactly once, not for every evaluation (or risk losing alert pending
+// states). So instead we return RuleGroup, which carries fully-converted
+// rules.Rule plus the group metadata (file, interval) a caller needs to
+// build its own *rules.Group from.
+func (c RulesConfig) parseV2() ([]RuleGroup, error) {
+	var groups []RuleGroup
 
 	for fn, content := range c.Files {
 		rgs, errs := rulefmt.Parse([]byte(content))
@@ -198,23 +234,34 @@ func (c RulesConfig) parseV2() (map[string][]rules.Rule, error) {
 		for _, rg := range rgs.Groups {
 			rls := make([]rules.Rule, 0, len(rg.Rules))
 			for _, rl := range rg.Rules {
-				expr, err := promql.ParseExpr(rl.Expr)
+				expr, err := parser.ParseExpr(rl.Expr)
 				if err != nil {
 					return nil, err
 				}
 
 				if rl.Alert != "" {
+					keepFiringFor, err := c.validateKeepFiringFor(rl, fn)
+					if err != nil {
+						return nil, err
+					}
+
 					rls = append(rls, rules.NewAlertingRule(
 						rl.Alert,
 						expr,
 						time.Duration(rl.For),
+						keepFiringFor,
 						labels.FromMap(rl.Labels),
 						labels.FromMap(rl.Annotations),
+						labels.Labels{}, // externalLabels: Cortex doesn't inject global external labels into rule evaluation
+						"",              // externalURL
 						true,
 						log.With(util.Logger, "alert", rl.Alert),
 					))
 					continue
 				}
+				if rl.KeepFiringFor != 0 {
+					return nil, fmt.Errorf("error parsing %s: keep_firing_for is only valid on alerting rules, not recording rule %q", fn, rl.Record)
+				}
 				rls = append(rls, rules.NewRecordingRule(
 					rl.Record,
 					expr,
@@ -222,56 +269,32 @@ func (c RulesConfig) parseV2() (map[string][]rules.Rule, error) {
 				))
 			}
 
-			// Group names have to be unique in Prometheus, but only within one rules file.
-			groups[rg.Name+";"+fn] = rls
+			groups = append(groups, RuleGroup{
+				Name:     rg.Name,
+				File:     fn,
+				Interval: time.Duration(rg.Interval),
+				Rules:    rls,
+			})
 		}
 	}
 
 	return groups, nil
 }
 
-// parseV1 parses and validates the content of the rule files in a RulesConfig
-// according to the Prometheus 1.x rule format.
-//
-// The same comment about rule groups as on ParseV2() applies here.
-func (c RulesConfig) parseV1() (map[string][]rules.Rule, error) {
-	result := map[string][]rules.Rule{}
-	for fn, content := range c.Files {
-		stmts, err := legacy_promql.ParseStmts(content)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing %s: %s", fn, err)
-		}
-		ra := []rules.Rule{}
-		for _, stmt := range stmts {
-			var rule rules.Rule
-
-			switch r := stmt.(type) {
-			case *legacy_promql.AlertStmt:
-				// Re-parse the expression to get it into the right types.
-				expr, err := promql.ParseExpr(r.Expr.String())
-				if err != nil {
-					return nil, err
-				}
-
-				rule = rules.NewAlertingRule(r.Name, expr, r.Duration, r.Labels, r.Annotations, true, util.Logger)
-
-			case *legacy_promql.RecordStmt:
-				// Re-parse the expression to get it into the right types.
-				expr, err := promql.ParseExpr(r.Expr.String())
-				if err != nil {
-					return nil, err
-				}
-
-				rule = rules.NewRecordingRule(r.Name, expr, r.Labels)
-
-			default:
-				return nil, fmt.Errorf("ruler.GetRules: unknown statement type")
-			}
-			ra = append(ra, rule)
-		}
-		result[fn] = ra
+// validateKeepFiringFor checks that rl.KeepFiringFor is only used on configs
+// that declare RuleFormatV3 or later and that it's non-negative, returning
+// the duration to pass to rules.NewAlertingRule.
+func (c RulesConfig) validateKeepFiringFor(rl rulefmt.Rule, fn string) (time.Duration, error) {
+	if rl.KeepFiringFor == 0 {
+		return 0, nil
+	}
+	if c.FormatVersion < RuleFormatV3 {
+		return 0, fmt.Errorf("error parsing %s: keep_firing_for requires rule_format_version 3 or greater", fn)
+	}
+	if rl.KeepFiringFor < 0 {
+		return 0, fmt.Errorf("error parsing %s: keep_firing_for must be non-negative, got %s", fn, time.Duration(rl.KeepFiringFor))
 	}
-	return result, nil
+	return time.Duration(rl.KeepFiringFor), nil
 }
 
 // VersionedRulesConfig is a RulesConfig together with a version.
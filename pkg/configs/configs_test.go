@@ -0,0 +1,102 @@
+package configs
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRulesConfig_Parse_LegacyFormatRejected(t *testing.T) {
+	c := RulesConfig{
+		FormatVersion: RuleFormatV1,
+		Files:         map[string]string{"a.rules": "ALERT Foo IF up == 0"},
+	}
+
+	_, err := c.Parse()
+	if err != ErrLegacyRuleFormat {
+		t.Fatalf("Parse() error = %v, want ErrLegacyRuleFormat", err)
+	}
+}
+
+func TestRulesConfig_Parse_V2GroupMetadata(t *testing.T) {
+	c := RulesConfig{
+		FormatVersion: RuleFormatV2,
+		Files: map[string]string{
+			"a.yaml": `
+groups:
+- name: my-group
+  interval: 30s
+  rules:
+  - record: foo
+    expr: up
+`,
+		},
+	}
+
+	groups, err := c.Parse()
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("len(groups) = %d, want 1", len(groups))
+	}
+	g := groups[0]
+	if g.Name != "my-group" {
+		t.Errorf("Name = %q, want %q", g.Name, "my-group")
+	}
+	if g.File != "a.yaml" {
+		t.Errorf("File = %q, want %q", g.File, "a.yaml")
+	}
+	if g.Interval.String() != "30s" {
+		t.Errorf("Interval = %v, want 30s", g.Interval)
+	}
+	if len(g.Rules) != 1 {
+		t.Fatalf("len(g.Rules) = %d, want 1", len(g.Rules))
+	}
+}
+
+func TestRulesConfig_Parse_KeepFiringForRequiresV3(t *testing.T) {
+	c := RulesConfig{
+		FormatVersion: RuleFormatV2,
+		Files: map[string]string{
+			"a.yaml": `
+groups:
+- name: my-group
+  rules:
+  - alert: Foo
+    expr: up == 0
+    keep_firing_for: 5m
+`,
+		},
+	}
+
+	_, err := c.Parse()
+	if err == nil || !strings.Contains(err.Error(), "rule_format_version 3") {
+		t.Fatalf("Parse() error = %v, want a rule_format_version 3 error", err)
+	}
+
+	c.FormatVersion = RuleFormatV3
+	if _, err := c.Parse(); err != nil {
+		t.Fatalf("Parse() with RuleFormatV3 error = %v, want nil", err)
+	}
+}
+
+func TestRulesConfig_Parse_KeepFiringForRejectedOnRecordingRule(t *testing.T) {
+	c := RulesConfig{
+		FormatVersion: RuleFormatV3,
+		Files: map[string]string{
+			"a.yaml": `
+groups:
+- name: my-group
+  rules:
+  - record: foo
+    expr: up
+    keep_firing_for: 5m
+`,
+		},
+	}
+
+	_, err := c.Parse()
+	if err == nil || !strings.Contains(err.Error(), "alerting rules") {
+		t.Fatalf("Parse() error = %v, want an alerting-rules-only error", err)
+	}
+}
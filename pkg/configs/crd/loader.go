@@ -0,0 +1,332 @@
+// Package crd lets the ruler load tenant rules from Kubernetes
+// monitoring.coreos.com/v1 PrometheusRule objects instead of (or alongside)
+// the configs DB, for users who already manage their alerting rules with
+// prometheus-operator.
+package crd
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/cortexproject/cortex/pkg/configs"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+// TenantMapper derives the tenant ID a PrometheusRule's config should be
+// filed under. Most deployments key tenants off a namespace or a label on
+// the object; callers supply whichever makes sense for their cluster.
+type TenantMapper func(rule *monitoringv1.PrometheusRule) (string, error)
+
+// Config configures a Loader.
+type Config struct {
+	// Selector restricts which PrometheusRule objects are watched.
+	Selector labels.Selector
+	// TenantMapper maps a watched PrometheusRule to the tenant ID whose
+	// RulesConfig it should contribute to.
+	TenantMapper TenantMapper
+	// Logger receives a warning for every PrometheusRule the Loader drops
+	// (TenantMapper error, malformed resourceVersion, unconvertible rule
+	// group, ...), so a failing TenantMapper or a malformed CRD doesn't
+	// vanish with zero signal. Objects that Selector filters out are skipped
+	// without a log line. Defaults to util.Logger if nil.
+	Logger log.Logger
+}
+
+// Loader watches PrometheusRule objects and synthesizes a per-tenant
+// configs.RulesConfig from them, satisfying configs.ConfigProvider so it can
+// be used by the ruler in place of (or alongside) the DB-backed source.
+type Loader struct {
+	cfg      Config
+	informer cache.SharedIndexInformer
+	logger   log.Logger
+
+	mtx          sync.RWMutex
+	views        map[string]configs.View // tenant ID -> current view
+	objectTenant map[string]string       // "namespace/name" -> tenant ID it was last filed under
+	nextID       int
+}
+
+// NewLoader creates a Loader. informer should be a SharedIndexInformer for
+// PrometheusRule objects, already scoped to whatever namespace the caller
+// wants watched; NewLoader only adds the label selector from cfg.
+func NewLoader(cfg Config, informer cache.SharedIndexInformer) (*Loader, error) {
+	if cfg.TenantMapper == nil {
+		return nil, fmt.Errorf("crd: TenantMapper is required")
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = util.Logger
+	}
+
+	l := &Loader{
+		cfg:          cfg,
+		informer:     informer,
+		logger:       logger,
+		views:        map[string]configs.View{},
+		objectTenant: map[string]string{},
+	}
+
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    l.handleUpsert,
+		UpdateFunc: func(_, obj interface{}) { l.handleUpsert(obj) },
+		DeleteFunc: l.handleDelete,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Run starts the underlying informer and blocks until stopCh is closed.
+func (l *Loader) Run(stopCh <-chan struct{}) {
+	l.informer.Run(stopCh)
+}
+
+// GetConfigs implements configs.ConfigProvider.
+func (l *Loader) GetConfigs(since configs.ID) (map[string]configs.View, error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	out := make(map[string]configs.View, len(l.views))
+	for tenant, view := range l.views {
+		if view.ID > since {
+			out[tenant] = view
+		}
+	}
+	return out, nil
+}
+
+// GetConfig implements configs.ConfigProvider.
+func (l *Loader) GetConfig(userID string) (configs.View, error) {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+
+	view, ok := l.views[userID]
+	if !ok {
+		return configs.View{}, fmt.Errorf("crd: no config loaded for tenant %q", userID)
+	}
+	return view, nil
+}
+
+func (l *Loader) handleUpsert(obj interface{}) {
+	rule, ok := obj.(*monitoringv1.PrometheusRule)
+	if !ok {
+		level.Warn(l.logger).Log("msg", "crd: dropping object of unexpected type", "type", fmt.Sprintf("%T", obj))
+		return
+	}
+	if l.cfg.Selector != nil && !l.cfg.Selector.Matches(labels.Set(rule.Labels)) {
+		return
+	}
+
+	tenant, err := l.cfg.TenantMapper(rule)
+	if err != nil {
+		level.Warn(l.logger).Log("msg", "crd: dropping PrometheusRule: TenantMapper failed", "namespace", rule.Namespace, "name", rule.Name, "err", err)
+		return
+	}
+
+	rulesConfig, err := toRulesConfig(rule)
+	if err != nil {
+		level.Warn(l.logger).Log("msg", "crd: dropping PrometheusRule: could not convert to RulesConfig", "namespace", rule.Namespace, "name", rule.Name, "err", err)
+		return
+	}
+
+	id, err := resourceVersionToID(rule.ResourceVersion)
+	if err != nil {
+		level.Warn(l.logger).Log("msg", "crd: dropping PrometheusRule: bad resourceVersion", "namespace", rule.Namespace, "name", rule.Name, "err", err)
+		return
+	}
+
+	filename := rule.Namespace + "/" + rule.Name + ".yaml"
+	objectKey := rule.Namespace + "/" + rule.Name
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	// If the object used to be filed under a different tenant (its
+	// TenantMapper result changed, e.g. a label it's keyed off of was
+	// edited), drop it from there first so it doesn't linger forever.
+	if oldTenant, ok := l.objectTenant[objectKey]; ok && oldTenant != tenant {
+		l.removeFileLocked(oldTenant, filename)
+	}
+	l.objectTenant[objectKey] = tenant
+
+	existing := l.views[tenant]
+	files := copyFiles(existing.Config.RulesConfig.Files)
+	for fn, content := range rulesConfig.Files {
+		files[fn] = content
+	}
+	existing.Config.RulesConfig.Files = files
+	// A tenant's published FormatVersion has to satisfy every file that
+	// went into it, so it only ever moves up to whatever the newest-format
+	// object requires (e.g. one CRD using keep_firing_for bumps the whole
+	// tenant to RuleFormatV3, even if its other files are plain V2).
+	if rulesConfig.FormatVersion > existing.Config.RulesConfig.FormatVersion {
+		existing.Config.RulesConfig.FormatVersion = rulesConfig.FormatVersion
+	}
+	existing.ID = l.nextIDLocked(id)
+	l.views[tenant] = existing
+}
+
+// removeFileLocked removes filename from tenant's published view, copying
+// the Files map first so any View already handed out to a caller (e.g. via
+// GetConfigs) keeps seeing its own, unmodified snapshot. l.mtx must be held.
+func (l *Loader) removeFileLocked(tenant, filename string) {
+	view, ok := l.views[tenant]
+	if !ok {
+		return
+	}
+	files := copyFiles(view.Config.RulesConfig.Files)
+	delete(files, filename)
+	view.Config.RulesConfig.Files = files
+	view.ID = l.nextIDLocked(view.ID)
+	l.views[tenant] = view
+}
+
+// copyFiles returns a new map with the same contents as m, so callers can
+// mutate the copy without racing with readers of a previously published
+// View that still holds a reference to m.
+func copyFiles(m map[string]string) map[string]string {
+	out := make(map[string]string, len(m)+1)
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+func (l *Loader) handleDelete(obj interface{}) {
+	rule, ok := obj.(*monitoringv1.PrometheusRule)
+	if !ok {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			rule, ok = d.Obj.(*monitoringv1.PrometheusRule)
+			if !ok {
+				level.Warn(l.logger).Log("msg", "crd: dropping delete of unexpected tombstone type", "type", fmt.Sprintf("%T", d.Obj))
+				return
+			}
+		} else {
+			level.Warn(l.logger).Log("msg", "crd: dropping delete of unexpected type", "type", fmt.Sprintf("%T", obj))
+			return
+		}
+	}
+
+	tenant, err := l.cfg.TenantMapper(rule)
+	if err != nil {
+		level.Warn(l.logger).Log("msg", "crd: dropping delete: TenantMapper failed", "namespace", rule.Namespace, "name", rule.Name, "err", err)
+		return
+	}
+
+	filename := rule.Namespace + "/" + rule.Name + ".yaml"
+	objectKey := rule.Namespace + "/" + rule.Name
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	delete(l.objectTenant, objectKey)
+	l.removeFileLocked(tenant, filename)
+}
+
+// nextIDLocked returns a view ID strictly greater than both the previous
+// highest ID handed out and the ID derived from the triggering object, so
+// IDs stay monotonically increasing across both creates/updates (keyed off
+// resourceVersion) and deletes (which have no resourceVersion of their own
+// to compare).
+func (l *Loader) nextIDLocked(candidate configs.ID) configs.ID {
+	l.nextID++
+	if int(candidate) >= l.nextID {
+		l.nextID = int(candidate) + 1
+	}
+	return configs.ID(l.nextID)
+}
+
+func resourceVersionToID(rv string) (configs.ID, error) {
+	n, err := strconv.Atoi(rv)
+	if err != nil {
+		return 0, fmt.Errorf("crd: non-numeric resourceVersion %q: %w", rv, err)
+	}
+	return configs.ID(n), nil
+}
+
+// toRulesConfig converts a single PrometheusRule's spec.groups into the v2
+// rulefmt YAML RulesConfig.Files expects, under one synthetic filename.
+//
+// This builds rulefmt.RuleGroups/rulefmt.Rule values field by field rather
+// than yaml.Marshal-ing rule.Spec directly: monitoringv1.Rule.Expr is an
+// intstr.IntOrString (only MarshalJSON, no MarshalYAML), so yaml.v2 would
+// serialize its internal type/intval/strval fields instead of the
+// expression string, and the CRD's json tags mean yaml.v2 falls back to
+// lowercasing field names and leaks CRD-only fields (e.g.
+// PartialResponseStrategy) that rulefmt's strict parser would reject.
+func toRulesConfig(rule *monitoringv1.PrometheusRule) (configs.RulesConfig, error) {
+	formatVersion := configs.RuleFormatV2
+
+	groups := make([]rulefmt.RuleGroup, 0, len(rule.Spec.Groups))
+	for _, g := range rule.Spec.Groups {
+		rg := rulefmt.RuleGroup{Name: g.Name}
+		if g.Interval != nil && *g.Interval != "" {
+			d, err := model.ParseDuration(string(*g.Interval))
+			if err != nil {
+				return configs.RulesConfig{}, fmt.Errorf("crd: error parsing interval of group %q in %s/%s: %w", g.Name, rule.Namespace, rule.Name, err)
+			}
+			rg.Interval = d
+		}
+
+		for _, r := range g.Rules {
+			rl := rulefmt.Rule{
+				Record:      r.Record,
+				Alert:       r.Alert,
+				Expr:        r.Expr.String(),
+				Labels:      r.Labels,
+				Annotations: r.Annotations,
+			}
+			if r.For != nil && *r.For != "" {
+				d, err := model.ParseDuration(string(*r.For))
+				if err != nil {
+					return configs.RulesConfig{}, fmt.Errorf("crd: error parsing for duration of rule %q in %s/%s: %w", ruleName(r), rule.Namespace, rule.Name, err)
+				}
+				rl.For = d
+			}
+			if r.KeepFiringFor != nil && *r.KeepFiringFor != "" {
+				d, err := model.ParseDuration(string(*r.KeepFiringFor))
+				if err != nil {
+					return configs.RulesConfig{}, fmt.Errorf("crd: error parsing keep_firing_for of rule %q in %s/%s: %w", ruleName(r), rule.Namespace, rule.Name, err)
+				}
+				rl.KeepFiringFor = d
+				// keep_firing_for is only accepted by RulesConfig.Parse on
+				// RuleFormatV3 or later; see validateKeepFiringFor.
+				formatVersion = configs.RuleFormatV3
+			}
+			rg.Rules = append(rg.Rules, rl)
+		}
+		groups = append(groups, rg)
+	}
+
+	out, err := yaml.Marshal(rulefmt.RuleGroups{Groups: groups})
+	if err != nil {
+		return configs.RulesConfig{}, fmt.Errorf("crd: error marshalling %s/%s: %w", rule.Namespace, rule.Name, err)
+	}
+
+	filename := rule.Namespace + "/" + rule.Name + ".yaml"
+	return configs.RulesConfig{
+		FormatVersion: formatVersion,
+		Files:         map[string]string{filename: string(out)},
+	}, nil
+}
+
+// ruleName returns whichever of Record/Alert is set, for error messages.
+func ruleName(r monitoringv1.Rule) string {
+	if r.Alert != "" {
+		return r.Alert
+	}
+	return r.Record
+}
@@ -0,0 +1,104 @@
+package crd
+
+import (
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	monitoringv1 "github.com/prometheus-operator/prometheus-operator/pkg/apis/monitoring/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"github.com/cortexproject/cortex/pkg/configs"
+)
+
+func newTestLoader(t *testing.T, mapper TenantMapper) *Loader {
+	t.Helper()
+	return &Loader{
+		cfg:          Config{TenantMapper: mapper},
+		logger:       log.NewNopLogger(),
+		views:        map[string]configs.View{},
+		objectTenant: map[string]string{},
+	}
+}
+
+func testRule(namespace, name, resourceVersion, tenantLabel string) *monitoringv1.PrometheusRule {
+	return &monitoringv1.PrometheusRule{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:       namespace,
+			Name:            name,
+			ResourceVersion: resourceVersion,
+			Labels:          map[string]string{"tenant": tenantLabel},
+		},
+		Spec: monitoringv1.PrometheusRuleSpec{
+			Groups: []monitoringv1.RuleGroup{
+				{
+					Name: "my-group",
+					Rules: []monitoringv1.Rule{
+						{Record: "foo", Expr: intstr.FromString("up")},
+					},
+				},
+			},
+		},
+	}
+}
+
+func mapperFromLabel(rule *monitoringv1.PrometheusRule) (string, error) {
+	return rule.Labels["tenant"], nil
+}
+
+func TestLoader_HandleUpsert_TenantReassignment(t *testing.T) {
+	l := newTestLoader(t, mapperFromLabel)
+
+	rule := testRule("ns", "my-rule", "1", "tenant-a")
+	l.handleUpsert(rule)
+
+	viewA, err := l.GetConfig("tenant-a")
+	if err != nil {
+		t.Fatalf("GetConfig(tenant-a) error = %v", err)
+	}
+	if len(viewA.Config.RulesConfig.Files) != 1 {
+		t.Fatalf("tenant-a has %d files, want 1", len(viewA.Config.RulesConfig.Files))
+	}
+
+	// Re-label the object so the TenantMapper now returns a different
+	// tenant: the old tenant's view must drop the file, not keep a stale
+	// copy around forever.
+	rule = testRule("ns", "my-rule", "2", "tenant-b")
+	l.handleUpsert(rule)
+
+	viewA, err = l.GetConfig("tenant-a")
+	if err != nil {
+		t.Fatalf("GetConfig(tenant-a) after reassignment error = %v", err)
+	}
+	if len(viewA.Config.RulesConfig.Files) != 0 {
+		t.Errorf("tenant-a still has %d files after reassignment, want 0", len(viewA.Config.RulesConfig.Files))
+	}
+
+	viewB, err := l.GetConfig("tenant-b")
+	if err != nil {
+		t.Fatalf("GetConfig(tenant-b) error = %v", err)
+	}
+	if len(viewB.Config.RulesConfig.Files) != 1 {
+		t.Fatalf("tenant-b has %d files, want 1", len(viewB.Config.RulesConfig.Files))
+	}
+}
+
+func TestLoader_HandleDelete_RemovesFile(t *testing.T) {
+	l := newTestLoader(t, mapperFromLabel)
+
+	rule := testRule("ns", "my-rule", "1", "tenant-a")
+	l.handleUpsert(rule)
+
+	l.handleDelete(rule)
+
+	view, err := l.GetConfig("tenant-a")
+	if err != nil {
+		t.Fatalf("GetConfig(tenant-a) error = %v", err)
+	}
+	if len(view.Config.RulesConfig.Files) != 0 {
+		t.Errorf("tenant-a has %d files after delete, want 0", len(view.Config.RulesConfig.Files))
+	}
+	if _, ok := l.objectTenant["ns/my-rule"]; ok {
+		t.Error("objectTenant still tracks ns/my-rule after delete")
+	}
+}
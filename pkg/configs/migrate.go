@@ -0,0 +1,88 @@
+package configs
+
+import (
+	"fmt"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"gopkg.in/yaml.v2"
+
+	legacy_promql "github.com/cortexproject/cortex/pkg/configs/legacy_promql"
+)
+
+// MigrateToV2 converts a RuleFormatV1 RulesConfig into an equivalent
+// RuleFormatV2 RulesConfig by parsing each legacy `.rules` file with
+// legacy_promql and re-emitting it as a single rulefmt.RuleGroups YAML
+// document per file. It is a one-shot conversion meant to be run once per
+// config during a rollout, so operators don't need to carry the legacy
+// parser forever; see ErrLegacyRuleFormat.
+//
+// groupInterval sets the evaluation interval on every migrated group; pass 0
+// to leave it unset, which makes the ruler fall back to its configured
+// default evaluation interval.
+func (c RulesConfig) MigrateToV2(groupInterval model.Duration) (RulesConfig, error) {
+	if c.FormatVersion != RuleFormatV1 {
+		return RulesConfig{}, fmt.Errorf("cannot migrate rules config with format version %v: not RuleFormatV1", c.FormatVersion)
+	}
+
+	files := make(map[string]string, len(c.Files))
+	for fn, content := range c.Files {
+		stmts, err := legacy_promql.ParseStmts(content)
+		if err != nil {
+			return RulesConfig{}, fmt.Errorf("error parsing %s: %s", fn, err)
+		}
+
+		group := rulefmt.RuleGroup{
+			Name:     fn,
+			Interval: groupInterval,
+		}
+
+		for _, stmt := range stmts {
+			switch r := stmt.(type) {
+			case *legacy_promql.AlertStmt:
+				group.Rules = append(group.Rules, rulefmt.Rule{
+					Alert:       r.Name,
+					Expr:        r.Expr.String(),
+					For:         model.Duration(r.Duration),
+					Labels:      labelsToMap(r.Labels),
+					Annotations: labelsToMap(r.Annotations),
+				})
+
+			case *legacy_promql.RecordStmt:
+				group.Rules = append(group.Rules, rulefmt.Rule{
+					Record: r.Name,
+					Expr:   r.Expr.String(),
+					Labels: labelsToMap(r.Labels),
+				})
+
+			default:
+				return RulesConfig{}, fmt.Errorf("migrating %s: unknown statement type", fn)
+			}
+		}
+
+		out, err := yaml.Marshal(rulefmt.RuleGroups{Groups: []rulefmt.RuleGroup{group}})
+		if err != nil {
+			return RulesConfig{}, fmt.Errorf("error marshalling migrated %s: %s", fn, err)
+		}
+		files[fn] = string(out)
+	}
+
+	return RulesConfig{
+		FormatVersion: RuleFormatV2,
+		Files:         files,
+	}, nil
+}
+
+// labelsToMap converts a labels.Labels into the map[string]string shape
+// rulefmt.Rule expects for its Labels/Annotations fields.
+func labelsToMap(lbls labels.Labels) map[string]string {
+	if len(lbls) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(lbls))
+	for _, l := range lbls {
+		m[l.Name] = l.Value
+	}
+	return m
+}
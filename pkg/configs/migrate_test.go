@@ -0,0 +1,46 @@
+package configs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestRulesConfig_MigrateToV2(t *testing.T) {
+	c := RulesConfig{
+		FormatVersion: RuleFormatV1,
+		Files: map[string]string{
+			"a.rules": `ALERT Foo IF up == 0 FOR 5m LABELS {severity="page"} ANNOTATIONS {summary="foo is down"}`,
+		},
+	}
+
+	migrated, err := c.MigrateToV2(model.Duration(time.Minute))
+	if err != nil {
+		t.Fatalf("MigrateToV2() error = %v", err)
+	}
+	if migrated.FormatVersion != RuleFormatV2 {
+		t.Fatalf("FormatVersion = %v, want RuleFormatV2", migrated.FormatVersion)
+	}
+
+	groups, err := migrated.Parse()
+	if err != nil {
+		t.Fatalf("Parse() of migrated config error = %v", err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("len(groups) = %d, want 1", len(groups))
+	}
+	if groups[0].Interval != time.Minute {
+		t.Errorf("Interval = %v, want %v (groupInterval not applied)", groups[0].Interval, time.Minute)
+	}
+	if len(groups[0].Rules) != 1 {
+		t.Fatalf("len(Rules) = %d, want 1", len(groups[0].Rules))
+	}
+}
+
+func TestRulesConfig_MigrateToV2_RejectsNonV1(t *testing.T) {
+	c := RulesConfig{FormatVersion: RuleFormatV2}
+	if _, err := c.MigrateToV2(0); err == nil {
+		t.Fatal("MigrateToV2() on a RuleFormatV2 config error = nil, want an error")
+	}
+}
@@ -0,0 +1,13 @@
+package configs
+
+// ConfigProvider is a source of per-tenant Cortex configs. The DB-backed
+// config service is the original implementation; ConfigProvider lets other
+// sources (e.g. the CRD loader in pkg/configs/crd) be used in its place
+// without the ruler needing to know which one it's talking to.
+type ConfigProvider interface {
+	// GetConfigs returns all configs with an ID greater than since.
+	GetConfigs(since ID) (map[string]View, error)
+
+	// GetConfig returns the latest config for the given tenant ID.
+	GetConfig(userID string) (View, error)
+}
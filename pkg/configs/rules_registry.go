@@ -0,0 +1,48 @@
+package configs
+
+import (
+	"sync"
+
+	"github.com/prometheus/prometheus/rules"
+)
+
+// RulesRegistry tracks the set of rules.Group currently loaded by the ruler
+// for each tenant. It exists so callers like the ruler's /api/v1/rules and
+// /api/v1/alerts handlers can introspect live rule and alert state (e.g.
+// alert `state`/`activeAt`/`value`) without re-parsing RulesConfig, which
+// would lose in-progress alert pending/firing state.
+type RulesRegistry struct {
+	mtx    sync.RWMutex
+	groups map[string][]*rules.Group // tenant ID -> currently loaded groups
+}
+
+// NewRulesRegistry creates an empty RulesRegistry.
+func NewRulesRegistry() *RulesRegistry {
+	return &RulesRegistry{
+		groups: map[string][]*rules.Group{},
+	}
+}
+
+// Set replaces the loaded rule groups for a tenant, e.g. after the ruler
+// reloads that tenant's RulesConfig.
+func (r *RulesRegistry) Set(tenantID string, groups []*rules.Group) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.groups[tenantID] = groups
+}
+
+// Delete removes a tenant's loaded rule groups, e.g. once the ruler stops
+// serving them.
+func (r *RulesRegistry) Delete(tenantID string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	delete(r.groups, tenantID)
+}
+
+// Get returns the currently loaded rule groups for a tenant, or nil if none
+// are loaded.
+func (r *RulesRegistry) Get(tenantID string) []*rules.Group {
+	r.mtx.RLock()
+	defer r.mtx.RUnlock()
+	return r.groups[tenantID]
+}
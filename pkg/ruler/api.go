@@ -0,0 +1,159 @@
+package ruler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/rules"
+	"github.com/weaveworks/common/user"
+
+	"github.com/cortexproject/cortex/pkg/configs"
+)
+
+// API serves Prometheus-compatible /api/v1/rules and /api/v1/alerts
+// endpoints, scoped to the calling tenant, by reading from a
+// configs.RulesRegistry rather than re-parsing RulesConfig on every request
+// (which would lose in-progress alert state).
+type API struct {
+	registry *configs.RulesRegistry
+}
+
+// NewAPI creates an API backed by the given registry.
+func NewAPI(registry *configs.RulesRegistry) *API {
+	return &API{registry: registry}
+}
+
+// apiResponse mirrors Prometheus's HTTP API envelope.
+type apiResponse struct {
+	Status string      `json:"status"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+type ruleGroup struct {
+	Name     string        `json:"name"`
+	File     string        `json:"file"`
+	Interval float64       `json:"interval"`
+	Rules    []interface{} `json:"rules"`
+}
+
+type alertingRule struct {
+	Name        string           `json:"name"`
+	Query       string           `json:"query"`
+	Duration    float64          `json:"duration"`
+	Labels      labels.Labels    `json:"labels"`
+	Annotations labels.Labels    `json:"annotations"`
+	Alerts      []*alert         `json:"alerts"`
+	Health      rules.RuleHealth `json:"health"`
+	Type        string           `json:"type"`
+}
+
+type recordingRule struct {
+	Name   string           `json:"name"`
+	Query  string           `json:"query"`
+	Labels labels.Labels    `json:"labels"`
+	Health rules.RuleHealth `json:"health"`
+	Type   string           `json:"type"`
+}
+
+type alert struct {
+	Labels      labels.Labels `json:"labels"`
+	Annotations labels.Labels `json:"annotations"`
+	State       string        `json:"state"`
+	ActiveAt    *string       `json:"activeAt"`
+	Value       string        `json:"value"`
+}
+
+// ListRules implements GET /api/v1/rules for the calling tenant.
+func (a *API) ListRules(w http.ResponseWriter, req *http.Request) {
+	tenantID, err := user.ExtractOrgID(req.Context())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	groups := a.registry.Get(tenantID)
+	result := make([]ruleGroup, 0, len(groups))
+	for _, g := range groups {
+		rg := ruleGroup{
+			Name:     g.Name(),
+			File:     g.File(),
+			Interval: g.Interval().Seconds(),
+		}
+		for _, r := range g.Rules() {
+			switch rule := r.(type) {
+			case *rules.AlertingRule:
+				rg.Rules = append(rg.Rules, alertingRule{
+					Name:        rule.Name(),
+					Query:       rule.Query().String(),
+					Duration:    rule.HoldDuration().Seconds(),
+					Labels:      rule.Labels(),
+					Annotations: rule.Annotations(),
+					Alerts:      activeAlerts(rule),
+					Health:      rule.Health(),
+					Type:        "alerting",
+				})
+			case *rules.RecordingRule:
+				rg.Rules = append(rg.Rules, recordingRule{
+					Name:   rule.Name(),
+					Query:  rule.Query().String(),
+					Labels: rule.Labels(),
+					Health: rule.Health(),
+					Type:   "recording",
+				})
+			}
+		}
+		result = append(result, rg)
+	}
+
+	respond(w, map[string]interface{}{"groups": result})
+}
+
+// ListAlerts implements GET /api/v1/alerts for the calling tenant.
+func (a *API) ListAlerts(w http.ResponseWriter, req *http.Request) {
+	tenantID, err := user.ExtractOrgID(req.Context())
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var alerts []*alert
+	for _, g := range a.registry.Get(tenantID) {
+		for _, r := range g.Rules() {
+			if ar, ok := r.(*rules.AlertingRule); ok {
+				alerts = append(alerts, activeAlerts(ar)...)
+			}
+		}
+	}
+
+	respond(w, map[string]interface{}{"alerts": alerts})
+}
+
+func activeAlerts(rule *rules.AlertingRule) []*alert {
+	var out []*alert
+	for _, a := range rule.ActiveAlerts() {
+		activeAt := a.ActiveAt.UTC().Format("2006-01-02T15:04:05.000Z07:00")
+		out = append(out, &alert{
+			Labels:      a.Labels,
+			Annotations: a.Annotations,
+			State:       a.State.String(),
+			ActiveAt:    &activeAt,
+			Value:       strconv.FormatFloat(a.Value, 'e', -1, 64),
+		})
+	}
+	return out
+}
+
+func respond(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(apiResponse{Status: "success", Data: data})
+}
+
+func respondError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(apiResponse{Status: "error", Error: err.Error()})
+}
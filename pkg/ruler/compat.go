@@ -0,0 +1,151 @@
+package ruler
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/storage"
+)
+
+// QueryContextFunc builds the context a single rule evaluation's PromQL
+// query runs under, given the engine's root context. It's how tenant
+// identity, deadlines and cancellation get attached to a query without the
+// ruler needing a promql.Engine per tenant: every tenant shares one engine,
+// and QueryContextFunc is what makes each query still carry that tenant's
+// identity and lifetime.
+//
+// Implementations should derive the returned context from root so that
+// cancelling root cancels their query too; Engine.Context enforces this
+// regardless (see its comment), but deriving from root directly also gets
+// you tenant-independent values (deadlines, etc.) the root may carry.
+type QueryContextFunc func(root context.Context, tenantID, ruleName string) (context.Context, context.CancelFunc)
+
+// DefaultQueryContextFunc derives a context.WithTimeout off root for every
+// query, with no tenant-specific behaviour. It's the QueryContextFunc
+// NewEngine uses when its queryContextFunc argument is nil; the hook is
+// passed to NewEngine, not read from a ruler Config field.
+func DefaultQueryContextFunc(timeout time.Duration) QueryContextFunc {
+	return func(root context.Context, _, _ string) (context.Context, context.CancelFunc) {
+		return context.WithTimeout(root, timeout)
+	}
+}
+
+// Engine wraps a single shared promql.Engine so that every tenant's rule
+// evaluations run against it, instead of constructing a new engine per
+// tenant the way Weaveworks' original ruler did. Per-tenant identity and
+// lifetime come from the context each query runs under (see
+// QueryContextFunc), not from separate engines; concurrencyGate is a single
+// limit shared by all tenants.
+type Engine struct {
+	engine           *promql.Engine
+	queryable        storage.Queryable
+	rootCtx          context.Context
+	rootCancel       context.CancelFunc
+	queryContextFunc QueryContextFunc
+	concurrencyGate  chan struct{}
+
+	evalDuration *prometheus.HistogramVec
+}
+
+// NewEngine creates an Engine. maxConcurrentQueries bounds how many
+// evaluations across all tenants may run their PromQL query at once; 0
+// means unbounded. queryContextFunc defaults to DefaultQueryContextFunc
+// derived from the returned Engine's root context if nil.
+func NewEngine(promEngine *promql.Engine, queryable storage.Queryable, maxConcurrentQueries int, queryContextFunc QueryContextFunc, reg prometheus.Registerer) *Engine {
+	rootCtx, rootCancel := context.WithCancel(context.Background())
+
+	e := &Engine{
+		engine:           promEngine,
+		queryable:        queryable,
+		rootCtx:          rootCtx,
+		rootCancel:       rootCancel,
+		queryContextFunc: queryContextFunc,
+		evalDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "cortex",
+			Name:      "ruler_query_evaluation_duration_seconds",
+			Help:      "Time spent evaluating a single rule's PromQL query, by tenant.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"user"}),
+	}
+	if e.queryContextFunc == nil {
+		e.queryContextFunc = DefaultQueryContextFunc(2 * time.Minute)
+	}
+	if maxConcurrentQueries > 0 {
+		e.concurrencyGate = make(chan struct{}, maxConcurrentQueries)
+	}
+	if reg != nil {
+		reg.MustRegister(e.evalDuration)
+	}
+	return e
+}
+
+// Stop cancels the engine's root context, which in turn cancels every
+// in-flight query derived from it across all tenants.
+func (e *Engine) Stop() {
+	e.rootCancel()
+}
+
+// QueryFunc returns a rules.QueryFunc-compatible function (see
+// github.com/prometheus/prometheus/rules) for one tenant, suitable for use
+// as the query function that tenant's rules.Groups evaluate with. It applies the
+// concurrency gate and records per-tenant evaluation duration; the context
+// passed to it should already be the one returned by e.Context.
+func (e *Engine) QueryFunc(tenantID string) func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+	return func(ctx context.Context, qs string, t time.Time) (promql.Vector, error) {
+		if e.concurrencyGate != nil {
+			select {
+			case e.concurrencyGate <- struct{}{}:
+				defer func() { <-e.concurrencyGate }()
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		start := time.Now()
+		defer func() { e.evalDuration.WithLabelValues(tenantID).Observe(time.Since(start).Seconds()) }()
+
+		q, err := e.engine.NewInstantQuery(ctx, e.queryable, nil, qs, t)
+		if err != nil {
+			return nil, err
+		}
+		defer q.Close()
+
+		res := q.Exec(ctx)
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		switch v := res.Value.(type) {
+		case promql.Vector:
+			return v, nil
+		case promql.Scalar:
+			return promql.Vector{promql.Sample{Point: promql.Point(v), Metric: nil}}, nil
+		default:
+			return nil, nil
+		}
+	}
+}
+
+// Context returns the per-query context.Context and context.CancelFunc for
+// one rule evaluation. It calls e's QueryContextFunc with e's root context,
+// but additionally guarantees that cancelling the root (Engine.Stop) cancels
+// the returned context even if the configured QueryContextFunc doesn't
+// derive from the root context it's given.
+func (e *Engine) Context(tenantID, ruleName string) (context.Context, context.CancelFunc) {
+	ctx, cancel := e.queryContextFunc(e.rootCtx, tenantID, ruleName)
+
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-e.rootCtx.Done():
+			cancel()
+		case <-stop:
+		}
+	}()
+
+	return ctx, func() {
+		close(stop)
+		cancel()
+	}
+}
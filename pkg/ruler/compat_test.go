@@ -0,0 +1,36 @@
+package ruler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestEngine_Stop_CancelsInFlightQueries guards the guarantee documented on
+// Engine.Context: even a QueryContextFunc that ignores the root context it's
+// given must still have its returned context cancelled once Engine.Stop is
+// called.
+func TestEngine_Stop_CancelsInFlightQueries(t *testing.T) {
+	ignoresRoot := func(_ context.Context, _, _ string) (context.Context, context.CancelFunc) {
+		return context.WithCancel(context.Background())
+	}
+
+	e := NewEngine(nil, nil, 0, ignoresRoot, nil)
+
+	ctx, cancel := e.Context("tenant-a", "my-rule")
+	defer cancel()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("context is already done before Stop")
+	default:
+	}
+
+	e.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("context was not cancelled within 1s of Engine.Stop")
+	}
+}
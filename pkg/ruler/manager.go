@@ -0,0 +1,42 @@
+package ruler
+
+import (
+	"github.com/prometheus/prometheus/rules"
+
+	"github.com/cortexproject/cortex/pkg/configs"
+)
+
+// LoadGroups parses tenantID's RulesConfig and wraps the resulting rules
+// into rules.Group values ready for evaluation, each configured to query
+// through e's shared engine via e.QueryFunc(tenantID). LoadGroups does not
+// call e.Context itself; see below. The groups are also published to
+// registry so /api/v1/rules and /api/v1/alerts can introspect their live
+// state.
+//
+// Note this is evaluation setup, not evaluation itself: callers are still
+// responsible for calling group.Eval(ctx, ...) on a schedule, passing the
+// ctx returned by e.Context(tenantID, group.Name()) so a ruler shutdown
+// (e.Stop) cancels every in-flight evaluation.
+func LoadGroups(tenantID string, cfg configs.RulesConfig, e *Engine, opts rules.ManagerOptions, registry *configs.RulesRegistry) ([]*rules.Group, error) {
+	parsed, err := cfg.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	groupOpts := opts
+	groupOpts.QueryFunc = e.QueryFunc(tenantID)
+
+	groups := make([]*rules.Group, 0, len(parsed))
+	for _, rg := range parsed {
+		groups = append(groups, rules.NewGroup(rules.GroupOptions{
+			Name:     rg.Name,
+			File:     rg.File,
+			Interval: rg.Interval,
+			Rules:    rg.Rules,
+			Opts:     &groupOpts,
+		}))
+	}
+
+	registry.Set(tenantID, groups)
+	return groups, nil
+}